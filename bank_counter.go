@@ -12,12 +12,16 @@ type ServeFunc func(ticket *Ticket) error
 type BankCounter struct {
 	queue *Queue
 	wg    sync.WaitGroup
+	retry *RateLimitingQueue // ServeFunc 失败的票据在这里限速重试
+
+	startRetryProcessor sync.Once
 }
 
 // NewBankCounter 创建一个新的银行柜台
 func NewBankCounter(queue *Queue) *BankCounter {
 	return &BankCounter{
 		queue: queue,
+		retry: NewRateLimitingQueue(DefaultRateLimiter()),
 	}
 }
 
@@ -33,10 +37,56 @@ func (bc *BankCounter) ServeCustomer(serveFn ServeFunc) {
 	// 启动一个新的 goroutine 来模拟服务过程
 	defer bc.wg.Done() // 完成后减少计数器
 
-	// 调用外部传入的服务函数
+	bc.serveWithRetry(ticket, serveFn)
+}
+
+// ServeTicket 服务一张调用方已经从某个 Queue 取出的票据，复用和
+// ServeCustomer 相同的限速重试路径。供已经自行决定了下一张票据的
+// 调用方使用（比如 CounterRegistry 的调度循环），这样就不会像直接
+// 调用 ServeCustomer 那样再从队列里多弹出一张不相关的票。
+func (bc *BankCounter) ServeTicket(ticket *Ticket, serveFn ServeFunc) {
+	bc.wg.Add(1)
+	defer bc.wg.Done()
+
+	bc.serveWithRetry(ticket, serveFn)
+}
+
+// serveWithRetry 调用外部传入的服务函数；如果失败，把票据放入
+// 限速重试队列，而不是像以前那样直接丢弃错误。第一次调用时会顺带
+// 启动后台的 ProcessRetries，否则重试队列只进不出，票据永远不会
+// 被真正重试。
+func (bc *BankCounter) serveWithRetry(ticket *Ticket, serveFn ServeFunc) {
+	bc.startRetryProcessor.Do(func() {
+		go bc.ProcessRetries(serveFn)
+	})
+
 	if err := serveFn(ticket); err != nil {
-		GetLogger().Info("Error serving customer %s with ticket number %d: %v\n", ticket.Name, ticket.Number, err)
-	} else {
-		GetLogger().Info("Finished serving customer %s with ticket number %d\n", ticket.Name, ticket.Number)
+		GetLogger().Info("Error serving customer %s with ticket number %d: %v, scheduling retry\n", ticket.Name, ticket.Number, err)
+		bc.retry.AddRateLimited(ticket)
+		return
 	}
+
+	bc.retry.Forget(ticket)
+	bc.queue.publish(ticket.Number, TicketEvent{TicketNumber: ticket.Number, State: TicketDone})
+	GetLogger().Info("Finished serving customer %s with ticket number %d\n", ticket.Name, ticket.Number)
+}
+
+// ProcessRetries 从重试队列中取出到期的票据并重新调用 serveFn，
+// 直到 Close 被调用后队列关闭。调用方通常在单独的 goroutine 中运行它。
+func (bc *BankCounter) ProcessRetries(serveFn ServeFunc) {
+	for {
+		item, shutdown := bc.retry.Get()
+		if shutdown {
+			return
+		}
+
+		ticket := item.(*Ticket)
+		bc.serveWithRetry(ticket, serveFn)
+		bc.retry.Done(ticket)
+	}
+}
+
+// Close 关闭重试队列，使 ProcessRetries 停止阻塞。
+func (bc *BankCounter) Close() {
+	bc.retry.ShutDown()
 }
@@ -0,0 +1,41 @@
+package quest_system
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestBankCounterRetriesFailedServe 验证 ServeFunc 第一次返回错误后，
+// 票据会被限速重试队列接住并自动重新调用，而不是像以前那样被
+// AddRateLimited 进去就再也没有消费者。
+func TestBankCounterRetriesFailedServe(t *testing.T) {
+	q := NewQueue()
+	bc := NewBankCounter(q)
+	defer bc.Close()
+
+	var attempts int32
+	done := make(chan struct{})
+
+	ticket := q.IssueTicket("Alice", 1)
+	bc.wg.Add(1)
+	go bc.ServeCustomer(func(ticket *Ticket) error {
+		n := atomic.AddInt32(&attempts, 1)
+		if n == 1 {
+			return errors.New("transient failure")
+		}
+		close(done)
+		return nil
+	})
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected ticket %d to be retried and eventually succeed, attempts=%d", ticket.Number, atomic.LoadInt32(&attempts))
+	}
+
+	if got := atomic.LoadInt32(&attempts); got < 2 {
+		t.Errorf("expected at least 2 attempts, got %d", got)
+	}
+}
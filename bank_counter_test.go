@@ -0,0 +1,33 @@
+package quest_system
+
+import "testing"
+
+// TestBankCounterServeTicketDoesNotTouchQueue 验证 ServeTicket 直接
+// 处理调用方传入的票据，既不会从 Queue 里再弹出一张票，也不会因为
+// 缺少 wg.Add 而在 wg.Done 上 panic。
+func TestBankCounterServeTicketDoesNotTouchQueue(t *testing.T) {
+	q := NewQueue()
+	other := q.IssueTicket("Other", 1)
+
+	bc := NewBankCounter(q)
+	defer bc.Close()
+
+	served := &Ticket{Number: 42, Name: "Direct"}
+
+	var got *Ticket
+	bc.ServeTicket(served, func(ticket *Ticket) error {
+		got = ticket
+		return nil
+	})
+
+	if got == nil || got.Number != served.Number {
+		t.Fatalf("expected ServeTicket to serve ticket %d directly, got %v", served.Number, got)
+	}
+
+	if q.GetQueueSize() != 1 {
+		t.Errorf("expected ServeTicket not to touch the queue, size = %d", q.GetQueueSize())
+	}
+	if !q.IsValidTicket(other.Number) {
+		t.Errorf("expected unrelated ticket %d to remain untouched", other.Number)
+	}
+}
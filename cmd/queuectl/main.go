@@ -0,0 +1,68 @@
+// Command queuectl 是 QueueSystem gRPC 服务的参考 CLI 客户端，
+// 主要用来在联调时手动发放/查看票据，不追求覆盖所有 RPC。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	pb "github.com/luyuancpp/queue_system/proto/queue_systempb"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "QueueSystem gRPC 服务地址")
+	name := flag.String("name", "", "发放票据时使用的客户名，留空则只查看队列长度")
+	priority := flag.Uint("priority", 0, "发放票据的优先级")
+	watch := flag.Uint("watch", 0, "持续监听指定票号的状态变化，0 表示不监听")
+	flag.Parse()
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("dial %s: %v", *addr, err)
+	}
+	defer conn.Close()
+
+	client := pb.NewQueueSystemClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if *name != "" {
+		resp, err := client.IssueTicket(ctx, &pb.IssueTicketRequest{Name: *name, Priority: uint32(*priority)})
+		if err != nil {
+			log.Fatalf("issue ticket: %v", err)
+		}
+		fmt.Printf("issued ticket %d for %s\n", resp.GetTicket().GetNumber(), resp.GetTicket().GetName())
+	}
+
+	size, err := client.GetQueueSize(ctx, &pb.GetQueueSizeRequest{})
+	if err != nil {
+		log.Fatalf("get queue size: %v", err)
+	}
+	fmt.Printf("queue size: %d\n", size.GetSize())
+
+	if *watch == 0 {
+		return
+	}
+
+	stream, err := client.WatchTicket(context.Background(), &pb.WatchTicketRequest{TicketNumber: uint32(*watch)})
+	if err != nil {
+		log.Fatalf("watch ticket: %v", err)
+	}
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Fatalf("recv ticket event: %v", err)
+		}
+		fmt.Printf("ticket %d -> %s (position %d)\n", event.GetTicketNumber(), event.GetState(), event.GetPosition())
+	}
+}
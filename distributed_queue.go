@@ -0,0 +1,411 @@
+package quest_system
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// ticketLeaseDuration 是票据在 etcd 中的租约有效期，与单机版的
+// ticketExpirationDuration 保持一致：节点下线后租约到期，票据自动失效。
+const ticketLeaseDuration = 30 * time.Second
+
+// DistributedQueue 在 Queue 的基础上把票据状态镜像到 etcd，
+// 使多个队列节点可以共享同一份排队视图。
+//
+// 故障转移语义：
+//   - 每个节点持有的票据通过一个 30s 的 etcd 租约维护，节点失联后
+//     租约到期，该节点写入的票据会被其他节点视为失效并重新入队。
+//   - IssueTicket/CancelTicket 在本地更新堆之后，会把结果写入
+//     prefix + "tickets/<number>"；其它节点通过 watch 回放相同的
+//     事件，从而在不共享内存的情况下收敛到一致的队列状态。
+//   - 调度职责（调用 ServeTicket 并把票据分配给空闲柜台）由
+//     CounterRegistry 通过 etcd 选举在多个节点间唯一确定，
+//     调度节点丢失 leadership 后会触发新一轮选举。
+type DistributedQueue struct {
+	*Queue
+
+	cli     *clientv3.Client
+	prefix  string
+	leaseID clientv3.LeaseID
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDistributedQueue 创建一个绑定到 etcd 集群的分布式队列，
+// 所有票据都会存放在 prefix 之下，并通过 watch 与其它节点保持同步。
+func NewDistributedQueue(cli *clientv3.Client, prefix string) (*DistributedQueue, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lease, err := cli.Grant(ctx, int64(ticketLeaseDuration.Seconds()))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("grant ticket lease: %w", err)
+	}
+
+	keepAlive, err := cli.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("keepalive ticket lease: %w", err)
+	}
+
+	dq := &DistributedQueue{
+		Queue:   NewQueue(),
+		cli:     cli,
+		prefix:  prefix,
+		leaseID: lease.ID,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	dq.wg.Add(2)
+	go dq.drainKeepAlive(keepAlive)
+	go dq.watchTickets()
+
+	return dq, nil
+}
+
+// Close 停止本节点的租约续约与 watch，不影响其它节点继续工作。
+func (dq *DistributedQueue) Close() {
+	dq.cancel()
+	dq.wg.Wait()
+}
+
+func (dq *DistributedQueue) ticketKey(number uint32) string {
+	return path.Join(dq.prefix, "tickets", fmt.Sprintf("%010d", number))
+}
+
+// IssueTicket 发放新票据并复制到 etcd，携带本节点的租约，
+// 这样本节点下线时租约过期，票据会在所有节点上一并消失。
+func (dq *DistributedQueue) IssueTicket(name string, priority uint32) (*Ticket, error) {
+	ticket := dq.Queue.IssueTicket(name, priority)
+
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return ticket, fmt.Errorf("marshal ticket %d: %w", ticket.Number, err)
+	}
+
+	if _, err := dq.cli.Put(dq.ctx, dq.ticketKey(ticket.Number), string(data), clientv3.WithLease(dq.leaseID)); err != nil {
+		return ticket, fmt.Errorf("put ticket %d: %w", ticket.Number, err)
+	}
+
+	return ticket, nil
+}
+
+// CancelTicket 取消本地票据并把取消状态回写到 etcd 供其它节点回放。
+func (dq *DistributedQueue) CancelTicket(ticketNumber uint32) (bool, error) {
+	if !dq.Queue.CancelTicket(ticketNumber) {
+		return false, nil
+	}
+
+	data, err := json.Marshal(&Ticket{Number: ticketNumber, IsCancelled: true})
+	if err != nil {
+		return true, fmt.Errorf("marshal cancellation for ticket %d: %w", ticketNumber, err)
+	}
+
+	if _, err := dq.cli.Put(dq.ctx, dq.ticketKey(ticketNumber), string(data), clientv3.WithLease(dq.leaseID)); err != nil {
+		return true, fmt.Errorf("put cancellation for ticket %d: %w", ticketNumber, err)
+	}
+
+	return true, nil
+}
+
+// watchTickets 监听 prefix+"tickets/" 下的事件，把其它节点发放或
+// 取消的票据回放到本地堆中，使本节点的 ServeTicket 也能看到它们。
+func (dq *DistributedQueue) watchTickets() {
+	defer dq.wg.Done()
+
+	watchCh := dq.cli.Watch(dq.ctx, path.Join(dq.prefix, "tickets")+"/", clientv3.WithPrefix())
+	for resp := range watchCh {
+		for _, ev := range resp.Events {
+			dq.applyEvent(ev)
+		}
+	}
+}
+
+func (dq *DistributedQueue) applyEvent(ev *clientv3.Event) {
+	switch ev.Type {
+	case clientv3.EventTypePut:
+		var t Ticket
+		if err := json.Unmarshal(ev.Kv.Value, &t); err != nil {
+			GetLogger().Error("decode replicated ticket %s: %v\n", ev.Kv.Key, err)
+			return
+		}
+		if t.IsCancelled {
+			dq.Queue.CancelTicket(t.Number)
+			return
+		}
+		dq.replay(&t)
+	case clientv3.EventTypeDelete:
+		// 租约到期导致的删除：与本地取消等价，重新入队交给调度节点处理。
+	}
+}
+
+// replay 把从 etcd 回放来的票据直接放入本地堆中，跳过号码分配，
+// 因为号码已经由发放它的节点决定。
+func (dq *DistributedQueue) replay(t *Ticket) {
+	dq.Queue.mu.Lock()
+	defer dq.Queue.mu.Unlock()
+
+	if _, exists := dq.Queue.ticketIndexMap[t.Number]; exists {
+		return
+	}
+
+	heap.Push(dq.Queue, t)
+	if t.Number >= dq.Queue.nextTicketNum {
+		dq.Queue.nextTicketNum = t.Number + 1
+	}
+}
+
+func (dq *DistributedQueue) drainKeepAlive(ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	defer dq.wg.Done()
+	for range ch {
+		// 续约成功的响应无需处理，停止读取即视为节点失联，租约到期。
+	}
+}
+
+// CounterRegistry 把一组 BankCounter 注册到 etcd，并通过选举选出
+// 唯一的调度节点负责调用 ServeTicket、把票据分配给空闲柜台。
+//
+// 空闲柜台的发现和分配完全通过 etcd 完成，而不是进程内的共享状态：
+// 每个柜台在自己空闲时把 prefix+"idle/<id>" 写成存在，繁忙时删除它；
+// 调度节点监听 prefix+"idle/" 维护一份本地缓存，挑一个空闲 id 之后
+// 把票据写到 prefix+"assign/<id>"。柜台监听自己的 assign key，
+// 收到票据后立即变为繁忙、处理、再变回空闲——这样分配就能跨进程、
+// 跨机器生效，调度节点本身是否同时也是一个柜台没有区别。
+type CounterRegistry struct {
+	cli    *clientv3.Client
+	prefix string
+	queue  *DistributedQueue
+
+	session  *concurrency.Session
+	election *concurrency.Election
+
+	mu   sync.Mutex
+	idle map[string]struct{}
+}
+
+func (cr *CounterRegistry) idleKey(id string) string   { return path.Join(cr.prefix, "idle", id) }
+func (cr *CounterRegistry) assignKey(id string) string { return path.Join(cr.prefix, "assign", id) }
+
+// NewDistributedBankCounter 创建一个会注册到 etcd 并参与调度选举的柜台。
+// id 在整个集群中必须唯一，serveFn 是真正执行业务服务的回调。
+func NewDistributedBankCounter(cli *clientv3.Client, prefix string, queue *DistributedQueue, id string, serveFn ServeFunc) (*CounterRegistry, *BankCounter, error) {
+	session, err := concurrency.NewSession(cli, concurrency.WithTTL(int(ticketLeaseDuration.Seconds())))
+	if err != nil {
+		return nil, nil, fmt.Errorf("new etcd session: %w", err)
+	}
+
+	if _, err := cli.Put(context.Background(), path.Join(prefix, "counters", id), id, clientv3.WithLease(session.Lease())); err != nil {
+		return nil, nil, fmt.Errorf("register counter %s: %w", id, err)
+	}
+
+	counter := NewBankCounter(queue.Queue)
+
+	registry := &CounterRegistry{
+		cli:      cli,
+		prefix:   prefix,
+		queue:    queue,
+		session:  session,
+		election: concurrency.NewElection(session, path.Join(prefix, "dispatcher")),
+		idle:     make(map[string]struct{}),
+	}
+
+	go registry.runCounter(id, counter, serveFn)
+	go registry.runDispatcher(id)
+
+	return registry, counter, nil
+}
+
+// runCounter 让柜台 id 参与分配协议：默认空闲，收到分配就变繁忙、
+// 调用 counter.ServeTicket 处理，处理完再变回空闲，如此循环直到
+// session 关闭。
+func (cr *CounterRegistry) runCounter(id string, counter *BankCounter, serveFn ServeFunc) {
+	ctx := cr.session.Client().Ctx()
+
+	if err := cr.markIdle(ctx, id); err != nil {
+		GetLogger().Error("mark counter %s idle: %v\n", id, err)
+		return
+	}
+
+	watchCh := cr.cli.Watch(ctx, cr.assignKey(id))
+	for resp := range watchCh {
+		for _, ev := range resp.Events {
+			if ev.Type != clientv3.EventTypePut {
+				continue
+			}
+
+			var ticket Ticket
+			if err := json.Unmarshal(ev.Kv.Value, &ticket); err != nil {
+				GetLogger().Error("decode assignment for counter %s: %v\n", id, err)
+				continue
+			}
+
+			if err := cr.markBusy(ctx, id); err != nil {
+				GetLogger().Error("mark counter %s busy: %v\n", id, err)
+			}
+
+			counter.ServeTicket(&ticket, serveFn)
+
+			if _, err := cr.cli.Delete(ctx, cr.assignKey(id)); err != nil {
+				GetLogger().Error("clear assignment for counter %s: %v\n", id, err)
+			}
+			if err := cr.markIdle(ctx, id); err != nil {
+				GetLogger().Error("mark counter %s idle: %v\n", id, err)
+			}
+		}
+	}
+}
+
+func (cr *CounterRegistry) markIdle(ctx context.Context, id string) error {
+	cr.mu.Lock()
+	cr.idle[id] = struct{}{}
+	cr.mu.Unlock()
+
+	_, err := cr.cli.Put(ctx, cr.idleKey(id), id, clientv3.WithLease(cr.session.Lease()))
+	return err
+}
+
+func (cr *CounterRegistry) markBusy(ctx context.Context, id string) error {
+	cr.mu.Lock()
+	delete(cr.idle, id)
+	cr.mu.Unlock()
+
+	_, err := cr.cli.Delete(ctx, cr.idleKey(id))
+	return err
+}
+
+// runDispatcher 参与 "dispatcher" 选举；当选后监听空闲柜台集合，
+// 循环调用 ServeTicket 并把票据分配给一个空闲柜台，直到丢失
+// leadership（进程退出或 session 因租约到期而关闭），此时 Campaign
+// 返回错误，新一轮选举会在存活节点间重新进行。
+func (cr *CounterRegistry) runDispatcher(selfID string) {
+	ctx := cr.session.Client().Ctx()
+
+	if err := cr.election.Campaign(ctx, selfID); err != nil {
+		GetLogger().Error("campaign for dispatcher: %v\n", err)
+		return
+	}
+	defer cr.election.Resign(context.Background())
+
+	go cr.watchIdleCounters(ctx)
+
+	for {
+		select {
+		case <-cr.session.Done():
+			return
+		default:
+		}
+
+		dispatched, err := dispatchOnce(cr.queue.Queue, cr.pickIdleCounter, func(id string, ticket *Ticket) error {
+			data, err := json.Marshal(ticket)
+			if err != nil {
+				return fmt.Errorf("marshal assignment for ticket %d: %w", ticket.Number, err)
+			}
+			if _, err := cr.cli.Put(ctx, cr.assignKey(id), string(data)); err != nil {
+				return fmt.Errorf("assign ticket %d to counter %s: %w", ticket.Number, id, err)
+			}
+
+			// 乐观地把这个柜台标记为繁忙，避免在它自己的 idle key 被
+			// 删除之前，同一轮循环把同一张票再分配给它。
+			cr.mu.Lock()
+			delete(cr.idle, id)
+			cr.mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			GetLogger().Error("dispatch ticket: %v\n", err)
+		}
+		if !dispatched {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+// dispatchOnce 尝试把队列里的下一张票据分配给一个空闲柜台。关键是
+// 顺序：只有 pickCounter 确实找到了一个空闲柜台之后，才会调用
+// queue.ServeTicket() 把票据弹出来；如果反过来先弹票再挑柜台，挑不
+// 到空闲柜台时票据已经从堆里消失，且没有任何地方会把它放回去，
+// 在持续满载、柜台全部繁忙的场景下会悄悄永久丢票。assign 负责把
+// 弹出的票据真正交给 id（生产环境里是写 etcd 的 assign key），它的
+// 错误会原样返回给调用方记录日志。
+func dispatchOnce(queue *Queue, pickCounter func() (string, bool), assign func(id string, ticket *Ticket) error) (bool, error) {
+	id, ok := pickCounter()
+	if !ok {
+		return false, nil
+	}
+
+	ticket, err := queue.ServeTicket()
+	if err != nil {
+		// 队列里没有等待中的票据，不是真正的错误，交给调用方退避重试。
+		return false, nil
+	}
+
+	if err := assign(id, ticket); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// watchIdleCounters 维护调度节点本地的空闲柜台缓存：启动时用一次
+// Get 加载当前快照，之后用 Watch 增量更新。
+func (cr *CounterRegistry) watchIdleCounters(ctx context.Context) {
+	idlePrefix := path.Join(cr.prefix, "idle") + "/"
+
+	resp, err := cr.cli.Get(ctx, idlePrefix, clientv3.WithPrefix())
+	if err != nil {
+		GetLogger().Error("list idle counters: %v\n", err)
+	} else {
+		cr.mu.Lock()
+		for _, kv := range resp.Kvs {
+			cr.idle[string(kv.Value)] = struct{}{}
+		}
+		cr.mu.Unlock()
+	}
+
+	watchCh := cr.cli.Watch(ctx, idlePrefix, clientv3.WithPrefix())
+	for wresp := range watchCh {
+		for _, ev := range wresp.Events {
+			id := string(ev.Kv.Value)
+			cr.mu.Lock()
+			switch ev.Type {
+			case clientv3.EventTypePut:
+				cr.idle[id] = struct{}{}
+			case clientv3.EventTypeDelete:
+				delete(cr.idle, idFromIdleKey(string(ev.Kv.Key)))
+			}
+			cr.mu.Unlock()
+		}
+	}
+}
+
+func idFromIdleKey(key string) string {
+	return path.Base(key)
+}
+
+// pickIdleCounter 从当前已知的空闲柜台集合中选出一个。抽成独立的
+// 小方法方便在不启动 etcd 的情况下单测挑选逻辑本身。
+func (cr *CounterRegistry) pickIdleCounter() (string, bool) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return pickFromSet(cr.idle)
+}
+
+// pickFromSet 从一个 set 里任意取出一个元素，是 pickIdleCounter
+// 背后不依赖 etcd 的纯函数部分。
+func pickFromSet(set map[string]struct{}) (string, bool) {
+	for id := range set {
+		return id, true
+	}
+	return "", false
+}
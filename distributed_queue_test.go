@@ -0,0 +1,94 @@
+package quest_system
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestPickFromSetReturnsAMember 验证从非空 set 里总能取出一个元素，
+// 这是 CounterRegistry.pickIdleCounter 挑选空闲柜台背后的纯逻辑。
+func TestPickFromSetReturnsAMember(t *testing.T) {
+	set := map[string]struct{}{"counter-1": {}, "counter-2": {}}
+
+	id, ok := pickFromSet(set)
+	if !ok {
+		t.Fatal("expected to pick a member from a non-empty set")
+	}
+	if _, exists := set[id]; !exists {
+		t.Errorf("picked id %q is not a member of the set", id)
+	}
+}
+
+// TestPickFromSetEmpty 验证空集合上没有可挑选的空闲柜台。
+func TestPickFromSetEmpty(t *testing.T) {
+	if _, ok := pickFromSet(map[string]struct{}{}); ok {
+		t.Error("expected no member to be picked from an empty set")
+	}
+}
+
+// TestDispatchOnceDoesNotPopWithoutIdleCounter 验证在没有空闲柜台
+// 时，dispatchOnce 根本不会从队列里弹出票据——如果反过来先弹票据
+// 再挑柜台，挑不到的话这张票就从堆里永久消失了。
+func TestDispatchOnceDoesNotPopWithoutIdleCounter(t *testing.T) {
+	q := NewQueue()
+	q.IssueTicket("Alice", 1)
+
+	dispatched, err := dispatchOnce(q, func() (string, bool) { return "", false }, func(string, *Ticket) error {
+		t.Fatal("assign should not be called when no idle counter is available")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("dispatchOnce: %v", err)
+	}
+	if dispatched {
+		t.Error("expected dispatchOnce to report no dispatch")
+	}
+	if q.GetQueueSize() != 1 {
+		t.Errorf("expected ticket to remain in the queue, size = %d", q.GetQueueSize())
+	}
+}
+
+// TestDispatchOnceAssignsToIdleCounter 验证存在空闲柜台时，
+// dispatchOnce 弹出队列里的下一张票据并把它交给 assign。
+func TestDispatchOnceAssignsToIdleCounter(t *testing.T) {
+	q := NewQueue()
+	ticket := q.IssueTicket("Alice", 1)
+
+	var assignedID string
+	var assignedTicket *Ticket
+	dispatched, err := dispatchOnce(q, func() (string, bool) { return "counter-1", true }, func(id string, t *Ticket) error {
+		assignedID = id
+		assignedTicket = t
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("dispatchOnce: %v", err)
+	}
+	if !dispatched {
+		t.Fatal("expected dispatchOnce to report a dispatch")
+	}
+	if assignedID != "counter-1" || assignedTicket == nil || assignedTicket.Number != ticket.Number {
+		t.Fatalf("expected ticket %d assigned to counter-1, got id=%q ticket=%v", ticket.Number, assignedID, assignedTicket)
+	}
+	if q.GetQueueSize() != 0 {
+		t.Errorf("expected ticket to be popped from the queue, size = %d", q.GetQueueSize())
+	}
+}
+
+// TestDispatchOnceReturnsAssignError 验证 assign 失败时，错误会原样
+// 冒泡给调用方，dispatched 报告为 false。
+func TestDispatchOnceReturnsAssignError(t *testing.T) {
+	q := NewQueue()
+	q.IssueTicket("Alice", 1)
+
+	wantErr := fmt.Errorf("boom")
+	dispatched, err := dispatchOnce(q, func() (string, bool) { return "counter-1", true }, func(string, *Ticket) error {
+		return wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("expected assign error to bubble up, got %v", err)
+	}
+	if dispatched {
+		t.Error("expected dispatchOnce to report no dispatch when assign fails")
+	}
+}
@@ -0,0 +1,121 @@
+package quest_system
+
+import "sort"
+
+// TicketState 描述一张票据在其生命周期中的状态迁移，
+// 对应 Queued -> Position-N -> Serving -> Done/Cancelled/Expired。
+type TicketState int
+
+const (
+	TicketQueued TicketState = iota
+	TicketServing
+	TicketDone
+	TicketCancelled
+	TicketExpired
+)
+
+// TicketEvent 是推送给订阅者的一次状态迁移通知。
+type TicketEvent struct {
+	TicketNumber uint32
+	State        TicketState
+	Position     int // 仅在 State == TicketQueued 时有意义
+}
+
+// subscriberChannelSize 是每个订阅者 channel 的缓冲区大小；
+// 慢消费者的 channel 写满之后，最旧的事件会被丢弃而不是阻塞发布方。
+const subscriberChannelSize = 16
+
+// Subscribe 返回一个只读 channel，推送 ticketNumber 对应票据的状态
+// 迁移，包括订阅发生时它已经处于的状态：IssueTicket 在调用方能拿到
+// 票号、进而调用 Subscribe 之前就已经同步发布过一次 Queued，单靠
+// 后续事件会永远错过这一条，所以这里在注册 channel 的同时，对仍在
+// 排队的票据补发一次当前的 Queued/Position。订阅在票据进入终态
+// （Serving 之后的 Done/Cancelled/Expired）或者调用方不再消费时结束；
+// 这里不主动关闭 channel，调用方可以简单地停止读取。
+func (q *Queue) Subscribe(ticketNumber uint32) <-chan TicketEvent {
+	ch := make(chan TicketEvent, subscriberChannelSize)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.subsMu.Lock()
+	if q.subs == nil {
+		q.subs = make(map[uint32][]chan TicketEvent)
+	}
+	q.subs[ticketNumber] = append(q.subs[ticketNumber], ch)
+	q.subsMu.Unlock()
+
+	if index, exists := q.ticketIndexMap[ticketNumber]; exists && !q.tickets[index].IsCancelled {
+		q.publish(ticketNumber, TicketEvent{TicketNumber: ticketNumber, State: TicketQueued, Position: q.positions()[ticketNumber]})
+	}
+
+	return ch
+}
+
+// hasSubscribers 报告当前是否存在任何订阅者。publishPositions 用它
+// 在没有人订阅时跳过对全部排队票据的排序，调用方不需要持有 q.mu。
+func (q *Queue) hasSubscribers() bool {
+	q.subsMu.Lock()
+	defer q.subsMu.Unlock()
+	return len(q.subs) > 0
+}
+
+// positions 按服务顺序给仍在排队（未取消）的票据编号，0 是下一个
+// 会被 ServeTicket 取出的票据。调用方必须已经持有 q.mu。
+func (q *Queue) positions() map[uint32]int {
+	ordered := make([]*Ticket, 0, len(q.tickets))
+	for _, t := range q.tickets {
+		if !t.IsCancelled {
+			ordered = append(ordered, t)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Priority == ordered[j].Priority {
+			return ordered[i].CreatedAt.Before(ordered[j].CreatedAt)
+		}
+		return ordered[i].Priority > ordered[j].Priority
+	})
+
+	pos := make(map[uint32]int, len(ordered))
+	for i, t := range ordered {
+		pos[t.Number] = i
+	}
+	return pos
+}
+
+// publishPositions 在排队顺序发生变化之后（发放/取消/取票），把每
+// 张仍在排队的票据的新位置推送给它的订阅者。调用方必须已经持有
+// q.mu。排序仍在排队的票据是 O(n log n) 的，在没有订阅者时完全没
+// 必要为每一次 Issue/Cancel/Serve/expire 都做一遍，所以这里先用一次
+// 廉价的 hasSubscribers 检查把这条路径短路掉。
+func (q *Queue) publishPositions() {
+	if !q.hasSubscribers() {
+		return
+	}
+	for number, position := range q.positions() {
+		q.publish(number, TicketEvent{TicketNumber: number, State: TicketQueued, Position: position})
+	}
+}
+
+// publish 把事件推送给 ticketNumber 对应的所有订阅者。channel 满了
+// 就丢弃最旧的一条腾出位置（drop-oldest），保证慢消费者不会拖慢
+// 发布方持有 q.mu 的操作。
+func (q *Queue) publish(ticketNumber uint32, event TicketEvent) {
+	q.subsMu.Lock()
+	defer q.subsMu.Unlock()
+
+	for _, ch := range q.subs[ticketNumber] {
+		select {
+		case ch <- event:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
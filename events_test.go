@@ -0,0 +1,119 @@
+package quest_system
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSubscribeReceivesLifecycleEvents 验证一张票据从发放、到服务
+// 这段生命周期里，订阅者能按顺序收到 Queued 和 Serving 两个事件。
+func TestSubscribeReceivesLifecycleEvents(t *testing.T) {
+	q := NewQueue()
+
+	ticket := q.IssueTicket("Alice", 1)
+	events := q.Subscribe(ticket.Number)
+
+	select {
+	case event := <-events:
+		if event.State != TicketQueued {
+			t.Fatalf("expected first event to be TicketQueued, got %v", event.State)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for queued event")
+	}
+
+	if _, err := q.ServeTicket(); err != nil {
+		t.Fatalf("ServeTicket: %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.State != TicketServing {
+			t.Fatalf("expected second event to be TicketServing, got %v", event.State)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for serving event")
+	}
+}
+
+// TestSubscribeReceivesDoneEvent 验证服务函数成功完成之后，订阅者
+// 会在 Serving 之后收到一个 Done 事件，标志票据进入终态。
+func TestSubscribeReceivesDoneEvent(t *testing.T) {
+	q := NewQueue()
+	bc := NewBankCounter(q)
+	defer bc.Close()
+
+	ticket := q.IssueTicket("Alice", 1)
+	events := q.Subscribe(ticket.Number)
+
+	bc.wg.Add(1)
+	bc.ServeCustomer(func(ticket *Ticket) error { return nil })
+
+	var states []TicketState
+	for i := 0; i < 3; i++ {
+		select {
+		case event := <-events:
+			states = append(states, event.State)
+			if event.State == TicketDone {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for done event, seen so far: %v", states)
+		}
+	}
+	t.Fatalf("expected to observe TicketDone, seen: %v", states)
+}
+
+// TestSubscribeReceivesPositionUpdates 验证排在后面的票据的
+// Position 会在前面的票被取消之后随之更新，而不是只在发放时推送一次。
+func TestSubscribeReceivesPositionUpdates(t *testing.T) {
+	q := NewQueue()
+
+	first := q.IssueTicket("Alice", 1)
+	second := q.IssueTicket("Bob", 1)
+	events := q.Subscribe(second.Number)
+
+	select {
+	case event := <-events:
+		if event.State != TicketQueued || event.Position != 1 {
+			t.Fatalf("expected initial position 1, got state=%v position=%d", event.State, event.Position)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for initial queued event")
+	}
+
+	if !q.CancelTicket(first.Number) {
+		t.Fatalf("expected to cancel ticket %d", first.Number)
+	}
+
+	select {
+	case event := <-events:
+		if event.State != TicketQueued || event.Position != 0 {
+			t.Fatalf("expected updated position 0 after cancellation, got state=%v position=%d", event.State, event.Position)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for updated position event")
+	}
+}
+
+// TestSubscribeDropsOldestOnSlowConsumer 验证订阅者不读取 channel
+// 时，后续事件不会阻塞发布方，而是丢弃最旧的事件。
+func TestSubscribeDropsOldestOnSlowConsumer(t *testing.T) {
+	q := NewQueue()
+	ticket := q.IssueTicket("Alice", 1)
+	_ = q.Subscribe(ticket.Number) // 故意不读取
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < subscriberChannelSize*2; i++ {
+			q.publish(ticket.Number, TicketEvent{TicketNumber: ticket.Number, State: TicketQueued})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a slow consumer")
+	}
+}
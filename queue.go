@@ -15,14 +15,32 @@ type Ticket struct {
 	Priority    uint32    // 用于优先队列的优先级
 	CreatedAt   time.Time // 记录票的创建时间，用于处理优先级相同的情况
 	IsCancelled bool      // 标记票是否被取消
+
+	// wheelNode 是这张票在 Queue.wheel 中的位置，仅在配置了
+	// 过期时间时使用，用来让 CancelTicket O(1) 地把它从时间轮里摘除。
+	wheelNode *wheelEntry
 }
 
+// defaultSnapshotEveryEntries 是在没有显式配置时，触发一次后台
+// 快照所需要累积的 WAL 条目数。
+const defaultSnapshotEveryEntries = 1000
+
 // Queue 代表排队的队列，使用优先队列（堆）实现
 type Queue struct {
 	tickets        []*Ticket
 	nextTicketNum  uint32 // 记录下一个生成的票号
 	mu             sync.Mutex
 	ticketIndexMap map[uint32]int // 用于快速查找票号在队列中的位置
+
+	storage              Storage // 为空表示不做持久化，行为与之前完全一致
+	snapshotEvery        int
+	entriesSinceSnapshot int
+
+	wheel          *TimingWheel  // 为空表示不启用过期，行为与之前完全一致
+	expirationTime time.Duration
+
+	subsMu sync.Mutex
+	subs   map[uint32][]chan TicketEvent
 }
 
 func NewQueue() *Queue {
@@ -33,6 +51,124 @@ func NewQueue() *Queue {
 	}
 }
 
+// NewQueueWithExpiration 创建一个票据会在 expirationTime 之后自动
+// 过期的 Queue。过期由分层时间轮驱动，在票据真正到期的那一刻把它
+// 标记为 IsCancelled 并从 ticketIndexMap 中移除，不再需要像旧版本
+// 那样每隔固定周期扫描一遍所有票据。
+func NewQueueWithExpiration(expirationTime time.Duration) *Queue {
+	q := &Queue{
+		tickets:        make([]*Ticket, 0),
+		ticketIndexMap: make(map[uint32]int),
+		expirationTime: expirationTime,
+	}
+	q.wheel = NewTimingWheel(q.expireTicket)
+	q.wheel.Start()
+	return q
+}
+
+// expireTicket 是时间轮到期时调用的回调：标记票据为取消并从索引
+// 中移除，堆里的条目会在下一次 ServeTicket 扫描到时自动跳过。和
+// Cancel/Serve 一样先落盘再变更内存状态，否则自动过期这件事对 WAL
+// 不可见，崩溃后在下一次快照之前重放就会让过期的票又"活过来"。
+func (q *Queue) expireTicket(ticket *Ticket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.appendEntry(Entry{Type: EntryExpire, TicketNumber: ticket.Number}); err != nil {
+		GetLogger().Error("append expire entry for ticket %d: %v\n", ticket.Number, err)
+	}
+
+	ticket.IsCancelled = true
+	delete(q.ticketIndexMap, ticket.Number)
+	q.publish(ticket.Number, TicketEvent{TicketNumber: ticket.Number, State: TicketExpired})
+	q.publishPositions()
+}
+
+// Close 停止后台驱动票据过期的时间轮（如果启用了过期时间的话）。
+func (q *Queue) Close() {
+	if q.wheel != nil {
+		q.wheel.Stop()
+	}
+}
+
+// NewQueueFromStorage 从 Storage 重放出票据状态并重建队列，
+// 用于进程重启后的恢复。Storage 不为空时，后续的 IssueTicket/
+// CancelTicket/ServeTicket/ResetTicketNumber 都会先落盘再变更堆，
+// 并且每累积 snapshotEvery 条 WAL 记录就在后台写一次快照。
+// expirationTime 非零时，和 NewQueueWithExpiration 一样挂上一个新的
+// 时间轮，把重放出来的、仍在排队的票据按它们各自距离过期还剩下的
+// 时间重新排进去——否则崩溃前配置的自动过期，在重启后会被悄悄丢掉，
+// 让本该过期的票据永久保持有效。
+func NewQueueFromStorage(s Storage, snapshotEvery int, expirationTime time.Duration) (*Queue, error) {
+	if snapshotEvery <= 0 {
+		snapshotEvery = defaultSnapshotEveryEntries
+	}
+
+	tickets, nextNum, err := s.Replay()
+	if err != nil {
+		return nil, fmt.Errorf("replay storage: %w", err)
+	}
+
+	q := &Queue{
+		tickets:        tickets,
+		nextTicketNum:  nextNum,
+		ticketIndexMap: make(map[uint32]int, len(tickets)),
+		storage:        s,
+		snapshotEvery:  snapshotEvery,
+		expirationTime: expirationTime,
+	}
+	for i, t := range tickets {
+		q.ticketIndexMap[t.Number] = i
+	}
+	heap.Init(q)
+
+	if expirationTime > 0 {
+		q.wheel = NewTimingWheel(q.expireTicket)
+		q.wheel.Start()
+
+		now := time.Now()
+		for _, t := range tickets {
+			if t.IsCancelled {
+				continue
+			}
+			remaining := expirationTime - now.Sub(t.QueueTime)
+			if remaining < 0 {
+				remaining = 0
+			}
+			q.wheel.Add(t, remaining)
+		}
+	}
+
+	return q, nil
+}
+
+// appendEntry 把 entry 写入 storage（如果配置了的话），并在累计
+// 达到 snapshotEvery 条记录时，在后台 goroutine 里触发一次快照。
+// 调用方必须已经持有 q.mu。
+func (q *Queue) appendEntry(e Entry) error {
+	if q.storage == nil {
+		return nil
+	}
+	if err := q.storage.AppendEntry(e); err != nil {
+		return err
+	}
+
+	q.entriesSinceSnapshot++
+	if q.entriesSinceSnapshot < q.snapshotEvery {
+		return nil
+	}
+	q.entriesSinceSnapshot = 0
+
+	snapshotTickets := append([]*Ticket(nil), q.tickets...)
+	go func() {
+		if err := q.storage.Snapshot(snapshotTickets); err != nil {
+			GetLogger().Error("snapshot queue: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
 // IssueTicket 发放一个新的票号
 func (q *Queue) IssueTicket(name string, priority uint32) *Ticket {
 	q.mu.Lock()
@@ -47,6 +183,11 @@ func (q *Queue) IssueTicket(name string, priority uint32) *Ticket {
 		CreatedAt: time.Now(), // 记录创建时间
 	}
 
+	// 先落盘，再变更堆，保证重放时不会丢失这张票
+	if err := q.appendEntry(Entry{Type: EntryIssue, Ticket: ticket}); err != nil {
+		GetLogger().Error("append issue entry for ticket %d: %v\n", ticket.Number, err)
+	}
+
 	// 将票号加入优先队列
 	heap.Push(q, ticket)
 
@@ -56,6 +197,12 @@ func (q *Queue) IssueTicket(name string, priority uint32) *Ticket {
 	// 将票号的索引保存到映射中
 	q.ticketIndexMap[ticket.Number] = len(q.tickets) - 1
 
+	if q.wheel != nil {
+		q.wheel.Add(ticket, q.expirationTime)
+	}
+
+	q.publishPositions()
+
 	return ticket
 }
 
@@ -66,7 +213,15 @@ func (q *Queue) CancelTicket(ticketNumber uint32) bool {
 
 	// 查找并取消该票号
 	if index, exists := q.ticketIndexMap[ticketNumber]; exists {
+		if err := q.appendEntry(Entry{Type: EntryCancel, TicketNumber: ticketNumber}); err != nil {
+			GetLogger().Error("append cancel entry for ticket %d: %v\n", ticketNumber, err)
+		}
 		q.tickets[index].IsCancelled = true // 标记为取消
+		if q.wheel != nil {
+			q.wheel.Remove(q.tickets[index])
+		}
+		q.publish(ticketNumber, TicketEvent{TicketNumber: ticketNumber, State: TicketCancelled})
+		q.publishPositions()
 		// 不需要调整堆，取消标记后，堆会在取票时自动跳过已取消的票
 		return true
 	}
@@ -106,6 +261,13 @@ func (q *Queue) ServeTicket() (*Ticket, error) {
 			continue
 		}
 
+		if err := q.appendEntry(Entry{Type: EntryServe, TicketNumber: ticket.Number}); err != nil {
+			GetLogger().Error("append serve entry for ticket %d: %v\n", ticket.Number, err)
+		}
+
+		q.publish(ticket.Number, TicketEvent{TicketNumber: ticket.Number, State: TicketServing})
+		q.publishPositions()
+
 		// 直接返回有效的票，不再需要手动删除 ticketIndexMap 中的条目
 		return ticket, nil
 	}
@@ -128,6 +290,10 @@ func (q *Queue) ResetTicketNumber() bool {
 		}
 	}
 
+	if err := q.appendEntry(Entry{Type: EntryReset}); err != nil {
+		GetLogger().Error("append reset entry: %v\n", err)
+	}
+
 	// 清空队列并重置票号计数器
 	q.nextTicketNum = 0
 	q.tickets = nil
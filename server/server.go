@@ -0,0 +1,122 @@
+// Package server 把 quest_system.Queue 包装成 gRPC 服务，
+// 对应 proto/queue_system.proto 里定义的 QueueSystem 接口。
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	quest_system "github.com/luyuancpp/queue_system"
+	pb "github.com/luyuancpp/queue_system/proto/queue_systempb"
+)
+
+// Server 实现 pb.QueueSystemServer，所有方法都直接委托给底层的
+// quest_system.Queue，不维护额外的状态。
+type Server struct {
+	pb.UnimplementedQueueSystemServer
+
+	queue *quest_system.Queue
+}
+
+// NewServer 创建一个包装了给定 Queue 的 gRPC 服务实现。
+func NewServer(queue *quest_system.Queue) *Server {
+	return &Server{queue: queue}
+}
+
+// Options 返回创建 grpc.Server 时应当使用的选项，调用方直接写
+// grpc.NewServer(server.Options()...)，目前只挂了结构化日志的
+// 一元拦截器。
+func Options() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(loggingInterceptor),
+	}
+}
+
+// loggingInterceptor 用仓库既有的 Logger 接口记录每个 RPC 的调用
+// 和结果，而不是引入一个新的日志框架。
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		quest_system.GetLogger().Error("%s failed: %v\n", info.FullMethod, err)
+	} else {
+		quest_system.GetLogger().Info("%s ok\n", info.FullMethod)
+	}
+	return resp, err
+}
+
+func (s *Server) IssueTicket(ctx context.Context, req *pb.IssueTicketRequest) (*pb.IssueTicketResponse, error) {
+	ticket := s.queue.IssueTicket(req.GetName(), req.GetPriority())
+	return &pb.IssueTicketResponse{Ticket: toProtoTicket(ticket)}, nil
+}
+
+func (s *Server) CancelTicket(ctx context.Context, req *pb.CancelTicketRequest) (*pb.CancelTicketResponse, error) {
+	cancelled := s.queue.CancelTicket(req.GetTicketNumber())
+	return &pb.CancelTicketResponse{Cancelled: cancelled}, nil
+}
+
+func (s *Server) ServeTicket(ctx context.Context, req *pb.ServeTicketRequest) (*pb.ServeTicketResponse, error) {
+	ticket, err := s.queue.ServeTicket()
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &pb.ServeTicketResponse{Ticket: toProtoTicket(ticket)}, nil
+}
+
+func (s *Server) GetQueueSize(ctx context.Context, req *pb.GetQueueSizeRequest) (*pb.GetQueueSizeResponse, error) {
+	return &pb.GetQueueSizeResponse{Size: int64(s.queue.GetQueueSize())}, nil
+}
+
+// WatchTicket 把 Queue.Subscribe 返回的事件 channel 逐条转发给
+// gRPC 客户端，直到 channel 关闭或者客户端断开连接。
+func (s *Server) WatchTicket(req *pb.WatchTicketRequest, stream pb.QueueSystem_WatchTicketServer) error {
+	events := s.queue.Subscribe(req.GetTicketNumber())
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(toProtoEvent(event)); err != nil {
+				return fmt.Errorf("send ticket event: %w", err)
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func toProtoTicket(t *quest_system.Ticket) *pb.Ticket {
+	return &pb.Ticket{
+		Number:      t.Number,
+		Name:        t.Name,
+		Priority:    t.Priority,
+		IsCancelled: t.IsCancelled,
+	}
+}
+
+func toProtoEvent(e quest_system.TicketEvent) *pb.TicketEvent {
+	var state pb.TicketState
+	switch e.State {
+	case quest_system.TicketQueued:
+		state = pb.TicketState_TICKET_STATE_QUEUED
+	case quest_system.TicketServing:
+		state = pb.TicketState_TICKET_STATE_SERVING
+	case quest_system.TicketDone:
+		state = pb.TicketState_TICKET_STATE_DONE
+	case quest_system.TicketCancelled:
+		state = pb.TicketState_TICKET_STATE_CANCELLED
+	case quest_system.TicketExpired:
+		state = pb.TicketState_TICKET_STATE_EXPIRED
+	}
+
+	return &pb.TicketEvent{
+		TicketNumber: e.TicketNumber,
+		State:        state,
+		Position:     int32(e.Position),
+	}
+}
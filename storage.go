@@ -0,0 +1,511 @@
+package quest_system
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// EntryType 标记一条 WAL 记录对应的操作。
+type EntryType int
+
+const (
+	EntryIssue EntryType = iota
+	EntryCancel
+	EntryServe
+	EntryReset
+	EntryExpire
+)
+
+// Entry 是 Issue/Cancel/Serve/Reset 四种操作的标签联合体，Replay
+// 只需要按顺序重放 Entry 就能重建队列状态。
+type Entry struct {
+	Type         EntryType
+	Ticket       *Ticket // EntryIssue 携带完整的票据
+	TicketNumber uint32  // EntryCancel/EntryServe 携带被操作的票号
+}
+
+// Storage 是 Queue 的持久化后端，仿照 etcd 的 WAL + 快照分层：
+// 每次变更先 AppendEntry 落盘，再定期 Snapshot 压缩历史，
+// Replay 在启动时用"最近一次快照 + 之后的 WAL"重建状态。
+type Storage interface {
+	AppendEntry(Entry) error
+	Snapshot(tickets []*Ticket) error
+	Replay() ([]*Ticket, uint32, error)
+}
+
+// FsyncPolicy 控制 FileStorage 落盘的持久性/吞吐权衡。
+type FsyncPolicy int
+
+const (
+	// FsyncAlways 每次 AppendEntry 都调用 fsync，最强的持久性保证。
+	FsyncAlways FsyncPolicy = iota
+	// FsyncBatch 按固定条数批量 fsync，用延迟换吞吐。
+	FsyncBatch
+	// FsyncNever 从不主动 fsync，交给操作系统决定落盘时机。
+	FsyncNever
+)
+
+// MemoryStorage 是只存在于内存中的 Storage 实现，用于测试：
+// 不做任何持久化，Replay 返回上一次 Snapshot 的内容加上之后的
+// Entry。
+type MemoryStorage struct {
+	mu       sync.Mutex
+	snapshot []*Ticket
+	entries  []Entry
+}
+
+// NewMemoryStorage 创建一个空的 MemoryStorage。
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (s *MemoryStorage) AppendEntry(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *MemoryStorage) Snapshot(tickets []*Ticket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = append([]*Ticket(nil), tickets...)
+	s.entries = nil
+	return nil
+}
+
+func (s *MemoryStorage) Replay() ([]*Ticket, uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tickets, index := replayEntries(s.snapshot, s.entries)
+	return tickets, nextTicketNumAfterReplay(tickets, index), nil
+}
+
+// replayEntries 把一份快照和快照之后的 Entry 列表重放成最终的票据
+// 集合，Issue 追加、Cancel/Serve 标记取消、Reset 清空。
+func replayEntries(snapshot []*Ticket, entries []Entry) ([]*Ticket, map[uint32]int) {
+	index := make(map[uint32]int)
+	tickets := make([]*Ticket, 0, len(snapshot))
+
+	appendTicket := func(t *Ticket) {
+		index[t.Number] = len(tickets)
+		tickets = append(tickets, t)
+	}
+	for _, t := range snapshot {
+		appendTicket(t)
+	}
+
+	for _, e := range entries {
+		switch e.Type {
+		case EntryIssue:
+			appendTicket(e.Ticket)
+		case EntryCancel, EntryExpire:
+			if i, ok := index[e.TicketNumber]; ok {
+				tickets[i].IsCancelled = true
+			}
+		case EntryServe:
+			// 和 Queue.ServeTicket() 里 heap.Pop 的效果保持一致：服务
+			// 过的票据要从列表里彻底移除，而不是像取消那样留在原地，
+			// 否则重启重放出来的队列里会多出一张"幽灵票"。
+			tickets, index = removeTicket(tickets, index, e.TicketNumber)
+		case EntryReset:
+			tickets = tickets[:0]
+			index = make(map[uint32]int)
+		}
+	}
+
+	return tickets, index
+}
+
+// removeTicket 把 number 对应的票据从 tickets 中彻底删除，并重建
+// 其余票据的索引。
+func removeTicket(tickets []*Ticket, index map[uint32]int, number uint32) ([]*Ticket, map[uint32]int) {
+	i, ok := index[number]
+	if !ok {
+		return tickets, index
+	}
+
+	tickets = append(tickets[:i], tickets[i+1:]...)
+	delete(index, number)
+	for num, idx := range index {
+		if idx > i {
+			index[num] = idx - 1
+		}
+	}
+	return tickets, index
+}
+
+func nextTicketNumAfterReplay(tickets []*Ticket, index map[uint32]int) uint32 {
+	var next uint32
+	for num := range index {
+		if num+1 > next {
+			next = num + 1
+		}
+	}
+	_ = tickets
+	return next
+}
+
+// FileStorage 把 WAL 写成一串长度前缀的二进制记录，每条记录附带
+// CRC32 校验，拒绝因为进程崩溃导致的半截写入；快照写到独立的文件，
+// Replay 时先加载快照再重放快照之后的 WAL 记录。
+type FileStorage struct {
+	mu sync.Mutex
+
+	walPath      string
+	snapshotPath string
+
+	wal    *os.File
+	writer *bufio.Writer
+
+	fsync         FsyncPolicy
+	batchSize     int
+	sinceLastSync int
+}
+
+// NewFileStorage 打开（或创建）walPath/snapshotPath 对应的文件。
+// batchSize 只在 fsync == FsyncBatch 时使用。
+func NewFileStorage(walPath, snapshotPath string, fsync FsyncPolicy, batchSize int) (*FileStorage, error) {
+	wal, err := os.OpenFile(walPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open wal %s: %w", walPath, err)
+	}
+
+	return &FileStorage{
+		walPath:      walPath,
+		snapshotPath: snapshotPath,
+		wal:          wal,
+		writer:       bufio.NewWriter(wal),
+		fsync:        fsync,
+		batchSize:    batchSize,
+	}, nil
+}
+
+// AppendEntry 把 entry 编码后以 "长度 | 数据 | CRC32" 的形式追加到
+// WAL 末尾，再按 fsync 策略决定是否立即落盘。
+func (s *FileStorage) AppendEntry(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := encodeEntry(e)
+	if err != nil {
+		return fmt.Errorf("encode entry: %w", err)
+	}
+
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	if _, err := s.writer.Write(header[:]); err != nil {
+		return fmt.Errorf("write entry length: %w", err)
+	}
+	if _, err := s.writer.Write(data); err != nil {
+		return fmt.Errorf("write entry body: %w", err)
+	}
+
+	var checksum [4]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.ChecksumIEEE(data))
+	if _, err := s.writer.Write(checksum[:]); err != nil {
+		return fmt.Errorf("write entry checksum: %w", err)
+	}
+
+	return s.maybeSync()
+}
+
+func (s *FileStorage) maybeSync() error {
+	switch s.fsync {
+	case FsyncNever:
+		return nil
+	case FsyncBatch:
+		s.sinceLastSync++
+		if s.sinceLastSync < s.batchSize {
+			return nil
+		}
+		s.sinceLastSync = 0
+	}
+
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("flush wal: %w", err)
+	}
+	return s.wal.Sync()
+}
+
+// Snapshot 把当前票据集合写入快照文件，并截断 WAL，使后续
+// Replay 只需要重放快照之后的增量。
+func (s *FileStorage) Snapshot(tickets []*Ticket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(tickets); err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	if err := os.WriteFile(s.snapshotPath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("flush wal before rotation: %w", err)
+	}
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	if _, err := s.wal.Seek(0, 0); err != nil {
+		return fmt.Errorf("seek wal: %w", err)
+	}
+	s.writer = bufio.NewWriter(s.wal)
+
+	return nil
+}
+
+// Replay 加载最近一次快照（如果存在），再顺序重放快照之后的 WAL
+// 记录，重建票据集合和下一个票号。遇到长度/CRC32 校验失败的半截
+// 记录即视为到达了 WAL 末尾，停止重放而不是返回错误。
+func (s *FileStorage) Replay() ([]*Ticket, uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, err := s.loadSnapshot()
+	if err != nil {
+		return nil, 0, fmt.Errorf("load snapshot: %w", err)
+	}
+
+	entries, err := s.loadWALEntries()
+	if err != nil {
+		return nil, 0, fmt.Errorf("load wal entries: %w", err)
+	}
+
+	tickets, index := replayEntries(snapshot, entries)
+	return tickets, nextTicketNumAfterReplay(tickets, index), nil
+}
+
+func (s *FileStorage) loadSnapshot() ([]*Ticket, error) {
+	data, err := os.ReadFile(s.snapshotPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tickets []*Ticket
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&tickets); err != nil {
+		return nil, err
+	}
+	return tickets, nil
+}
+
+func (s *FileStorage) loadWALEntries() ([]Entry, error) {
+	if _, err := s.wal.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(s.wal)
+
+	var entries []Entry
+	for {
+		var header [4]byte
+		if _, err := readFull(r, header[:]); err != nil {
+			break // 文件结尾，或者只写了半截长度
+		}
+		length := binary.BigEndian.Uint32(header[:])
+
+		data := make([]byte, length)
+		if _, err := readFull(r, data); err != nil {
+			break // 半截记录，丢弃并停止重放
+		}
+
+		var checksum [4]byte
+		if _, err := readFull(r, checksum[:]); err != nil {
+			break
+		}
+		if binary.BigEndian.Uint32(checksum[:]) != crc32.ChecksumIEEE(data) {
+			break // 校验失败，视为损坏的尾部记录
+		}
+
+		entry, err := decodeEntry(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if _, err := s.wal.Seek(0, 2); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func readFull(r *bufio.Reader, buf []byte) (int, error) {
+	total := 0
+	for total < len(buf) {
+		n, err := r.Read(buf[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// encodeEntry 把 Entry 编码成 protobuf wire format。字段号和语义对应
+// proto/wal.proto 里的 WalEntry 消息；这里手写 protowire 调用而不是
+// 依赖生成代码，是因为这份 WAL 记录格式只在 FileStorage 内部使用，
+// 不需要跨语言/跨进程的 .proto 契约。
+func encodeEntry(e Entry) ([]byte, error) {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(e.Type))
+
+	if e.Ticket != nil {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeTicket(e.Ticket))
+	}
+
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(e.TicketNumber))
+
+	return b, nil
+}
+
+func decodeEntry(data []byte) (Entry, error) {
+	var e Entry
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return Entry{}, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case 1:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return Entry{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+			e.Type = EntryType(v)
+		case 2:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return Entry{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+			ticket, err := decodeTicket(v)
+			if err != nil {
+				return Entry{}, fmt.Errorf("decode ticket: %w", err)
+			}
+			e.Ticket = ticket
+		case 3:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return Entry{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+			e.TicketNumber = uint32(v)
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return Entry{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return e, nil
+}
+
+// encodeTicket/decodeTicket 对应 WalTicket 消息，time.Time 字段在线
+// 上以 unix 纳秒的 varint 传输。
+func encodeTicket(t *Ticket) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(t.Number))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, t.Name)
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(t.QueueTime.UnixNano()))
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(t.Priority))
+	b = protowire.AppendTag(b, 5, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(t.CreatedAt.UnixNano()))
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, boolToVarint(t.IsCancelled))
+	return b
+}
+
+func decodeTicket(data []byte) (*Ticket, error) {
+	t := &Ticket{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case 1:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			t.Number = uint32(v)
+		case 2:
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			t.Name = v
+		case 3:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			t.QueueTime = time.Unix(0, int64(v))
+		case 4:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			t.Priority = uint32(v)
+		case 5:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			t.CreatedAt = time.Unix(0, int64(v))
+		case 6:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			t.IsCancelled = v != 0
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return t, nil
+}
+
+func boolToVarint(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
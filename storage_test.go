@@ -0,0 +1,179 @@
+package quest_system
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestQueueReplaysFromMemoryStorage 验证通过 MemoryStorage 持久化的
+// Issue/Cancel 操作，可以在 NewQueueFromStorage 中被正确重放。
+func TestQueueReplaysFromMemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	q, err := NewQueueFromStorage(storage, 0, 0)
+	if err != nil {
+		t.Fatalf("NewQueueFromStorage: %v", err)
+	}
+
+	alice := q.IssueTicket("Alice", 1)
+	q.IssueTicket("Bob", 2)
+	if !q.CancelTicket(alice.Number) {
+		t.Fatalf("expected to cancel ticket %d", alice.Number)
+	}
+
+	restored, err := NewQueueFromStorage(storage, 0, 0)
+	if err != nil {
+		t.Fatalf("NewQueueFromStorage after replay: %v", err)
+	}
+
+	if got := restored.GetQueueSize(); got != 2 {
+		t.Errorf("expected 2 tickets (including the cancelled one), got %d", got)
+	}
+	if restored.IsValidTicket(alice.Number) {
+		t.Errorf("expected ticket %d to still be cancelled after replay", alice.Number)
+	}
+}
+
+// TestQueueReplaysServedTicketIsRemoved 验证 ServeTicket 服务过的票据
+// 在重放之后被彻底移除，而不是像取消一样留在票据列表里变成一张
+// 重启后又"复活"的幽灵票。
+func TestQueueReplaysServedTicketIsRemoved(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	q, err := NewQueueFromStorage(storage, 0, 0)
+	if err != nil {
+		t.Fatalf("NewQueueFromStorage: %v", err)
+	}
+
+	// 两张票用相同的优先级发放，这样 Queue.Less 按创建时间的 tie-break
+	// 生效，Alice 一定先被服务——如果用不同优先级，优先级更高的 Bob
+	// 才会先被取出，测试的前提假设就错了。
+	alice := q.IssueTicket("Alice", 1)
+	q.IssueTicket("Bob", 1)
+	served, err := q.ServeTicket()
+	if err != nil {
+		t.Fatalf("ServeTicket: %v", err)
+	}
+	if served.Number != alice.Number {
+		t.Fatalf("expected to serve ticket %d first, served %d", alice.Number, served.Number)
+	}
+
+	restored, err := NewQueueFromStorage(storage, 0, 0)
+	if err != nil {
+		t.Fatalf("NewQueueFromStorage after replay: %v", err)
+	}
+
+	if got := restored.GetQueueSize(); got != 1 {
+		t.Errorf("expected served ticket to be gone after replay, got queue size %d", got)
+	}
+	if _, exists := restored.GetTicketIndex(alice.Number); exists {
+		t.Errorf("expected served ticket %d to have no index entry after replay", alice.Number)
+	}
+}
+
+// TestExpireTicketIsPersisted 验证时间轮自动过期一张票据时，这次
+// 过期也会像 Issue/Cancel/Serve 一样落盘：崩溃重启后重放出来的票据
+// 仍然是已取消状态，而不是在下一次快照之前"复活"。
+func TestExpireTicketIsPersisted(t *testing.T) {
+	storage := NewMemoryStorage()
+	q := &Queue{
+		tickets:        make([]*Ticket, 0),
+		ticketIndexMap: make(map[uint32]int),
+		expirationTime: 20 * time.Millisecond,
+		storage:        storage,
+		snapshotEvery:  defaultSnapshotEveryEntries,
+	}
+	q.wheel = NewTimingWheel(q.expireTicket)
+	q.wheel.Start()
+	defer q.Close()
+
+	ticket := q.IssueTicket("Alice", 1)
+
+	// 故意给比时间轮最低一层 tick (100ms) 更紧的截止时间，证明过期
+	// 确实发生在亚秒级，而不是被最低层的 tick 粒度拖到将近 1s。
+	deadline := time.After(400 * time.Millisecond)
+	for q.IsValidTicket(ticket.Number) {
+		select {
+		case <-deadline:
+			t.Fatalf("ticket %d did not expire within the wheel's sub-second precision", ticket.Number)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	restored, err := NewQueueFromStorage(storage, 0, 0)
+	if err != nil {
+		t.Fatalf("NewQueueFromStorage: %v", err)
+	}
+	if restored.IsValidTicket(ticket.Number) {
+		t.Errorf("expected expired ticket %d to still be cancelled after replay", ticket.Number)
+	}
+}
+
+// TestQueueFromStorageRearmsExpiration 验证带过期时间的 Queue 崩溃
+// 重启后，重放出来的票据仍然会按原定的过期时间自动过期，而不是因为
+// NewQueueFromStorage 忘记重新挂上时间轮而永久保持有效。
+func TestQueueFromStorageRearmsExpiration(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	q, err := NewQueueFromStorage(storage, 0, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewQueueFromStorage: %v", err)
+	}
+	ticket := q.IssueTicket("Alice", 1)
+	q.Close()
+
+	restored, err := NewQueueFromStorage(storage, 0, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewQueueFromStorage after replay: %v", err)
+	}
+	defer restored.Close()
+
+	deadline := time.After(time.Second)
+	for restored.IsValidTicket(ticket.Number) {
+		select {
+		case <-deadline:
+			t.Fatalf("ticket %d did not expire after being replayed from storage", ticket.Number)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// TestFileStorageAppendAndReplay 验证 FileStorage 把条目写入 WAL
+// 之后，重新打开同一对文件可以重放出相同的状态。
+func TestFileStorageAppendAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "queue.wal")
+	snapshotPath := filepath.Join(dir, "queue.snapshot")
+
+	storage, err := NewFileStorage(walPath, snapshotPath, FsyncAlways, 1)
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+
+	q, err := NewQueueFromStorage(storage, 0, 0)
+	if err != nil {
+		t.Fatalf("NewQueueFromStorage: %v", err)
+	}
+
+	q.IssueTicket("Alice", 1)
+	bob := q.IssueTicket("Bob", 2)
+	q.CancelTicket(bob.Number)
+
+	reopened, err := NewFileStorage(walPath, snapshotPath, FsyncAlways, 1)
+	if err != nil {
+		t.Fatalf("reopen FileStorage: %v", err)
+	}
+
+	restored, err := NewQueueFromStorage(reopened, 0, 0)
+	if err != nil {
+		t.Fatalf("NewQueueFromStorage after reopen: %v", err)
+	}
+
+	if got := restored.GetQueueSize(); got != 2 {
+		t.Errorf("expected 2 tickets after reopening wal, got %d", got)
+	}
+	if restored.IsValidTicket(bob.Number) {
+		t.Errorf("expected ticket %d to still be cancelled after reopening wal", bob.Number)
+	}
+}
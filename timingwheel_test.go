@@ -0,0 +1,75 @@
+package quest_system
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTimingWheelFiresOnExpiry 验证加入时间轮的票据会在大约到期
+// 时刻被回调标记，而不是提前或者长时间之后才触发。
+func TestTimingWheelFiresOnExpiry(t *testing.T) {
+	var mu sync.Mutex
+	var fired *Ticket
+
+	tw := NewTimingWheel(func(ticket *Ticket) {
+		mu.Lock()
+		fired = ticket
+		mu.Unlock()
+	})
+	tw.Start()
+	defer tw.Stop()
+
+	ticket := &Ticket{Number: 1, Name: "Alice"}
+	tw.Add(ticket, 1500*time.Millisecond)
+
+	time.Sleep(2500 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fired == nil || fired.Number != ticket.Number {
+		t.Fatalf("expected ticket %d to fire, got %v", ticket.Number, fired)
+	}
+}
+
+// TestTimingWheelRemoveCancelsExpiry 验证在到期之前 Remove 的票据
+// 不会再触发过期回调。
+func TestTimingWheelRemoveCancelsExpiry(t *testing.T) {
+	var mu sync.Mutex
+	fired := false
+
+	tw := NewTimingWheel(func(ticket *Ticket) {
+		mu.Lock()
+		fired = true
+		mu.Unlock()
+	})
+	tw.Start()
+	defer tw.Stop()
+
+	ticket := &Ticket{Number: 1, Name: "Alice"}
+	tw.Add(ticket, 500*time.Millisecond)
+	tw.Remove(ticket)
+
+	time.Sleep(1 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fired {
+		t.Errorf("expected removed ticket not to fire")
+	}
+}
+
+// TestQueueWithExpirationCancelsTicket 验证 NewQueueWithExpiration
+// 创建的 Queue 会在配置的过期时间之后，把票据标记为取消。
+func TestQueueWithExpirationCancelsTicket(t *testing.T) {
+	q := NewQueueWithExpiration(1 * time.Second)
+	defer q.Close()
+
+	ticket := q.IssueTicket("Alice", 1)
+
+	time.Sleep(2 * time.Second)
+
+	if q.IsValidTicket(ticket.Number) {
+		t.Errorf("expected ticket %d to have expired", ticket.Number)
+	}
+}
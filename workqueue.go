@@ -0,0 +1,373 @@
+package quest_system
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// WorkQueue 是一个去重的工作队列，设计上借鉴了 client-go
+// client-go/util/workqueue：一个保存实际顺序的堆（queue）、
+// 一个记录"待处理"条目的 dirty 集合，以及一个记录"正在被某个
+// worker 处理"条目的 processing 集合。这样同一个条目在处理期间
+// 再次被 Add，也只会在当前这一轮处理完后被重新处理一次，
+// 而不会排队两次。
+type WorkQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	queue      []interface{}
+	dirty      map[interface{}]struct{}
+	processing map[interface{}]struct{}
+
+	shuttingDown bool
+}
+
+// NewWorkQueue 创建一个空的 WorkQueue。
+func NewWorkQueue() *WorkQueue {
+	q := &WorkQueue{
+		dirty:      make(map[interface{}]struct{}),
+		processing: make(map[interface{}]struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Add 把 item 标记为待处理。如果 item 已经在 dirty 集合中，
+// 或者正在被处理（会在 Done 时被重新标记为待处理），这次调用不会
+// 产生额外的排队。
+func (q *WorkQueue) Add(item interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.shuttingDown {
+		return
+	}
+	if _, exists := q.dirty[item]; exists {
+		return
+	}
+
+	q.dirty[item] = struct{}{}
+	if _, exists := q.processing[item]; exists {
+		return
+	}
+
+	q.queue = append(q.queue, item)
+	q.cond.Signal()
+}
+
+// Get 阻塞直到有条目可取，返回该条目并把它从 dirty 移动到
+// processing。shutdown 为 true 时表示队列已关闭且没有更多条目。
+func (q *WorkQueue) Get() (item interface{}, shutdown bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.queue) == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if len(q.queue) == 0 {
+		return nil, true
+	}
+
+	item = q.queue[0]
+	q.queue = q.queue[1:]
+
+	q.processing[item] = struct{}{}
+	delete(q.dirty, item)
+
+	return item, false
+}
+
+// Done 标记 item 处理完成。如果它在处理期间被重新 Add 过（仍在
+// dirty 中），就立刻把它重新放回队列，交给下一个 worker。
+func (q *WorkQueue) Done(item interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.processing, item)
+	if _, dirty := q.dirty[item]; dirty {
+		q.queue = append(q.queue, item)
+		q.cond.Signal()
+	}
+}
+
+// Len 返回当前排队等待处理的条目数量。
+func (q *WorkQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queue)
+}
+
+// ShutDown 关闭队列，唤醒所有阻塞在 Get 上的 worker。
+func (q *WorkQueue) ShutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+// waitingItem 是延迟堆中的一个条目，按 readyAt 排序。
+type waitingItem struct {
+	item    interface{}
+	readyAt time.Time
+	index   int
+}
+
+type waitingHeap []*waitingItem
+
+func (h waitingHeap) Len() int            { return len(h) }
+func (h waitingHeap) Less(i, j int) bool  { return h[i].readyAt.Before(h[j].readyAt) }
+func (h waitingHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i]; h[i].index = i; h[j].index = j }
+func (h *waitingHeap) Push(x interface{}) {
+	wi := x.(*waitingItem)
+	wi.index = len(*h)
+	*h = append(*h, wi)
+}
+func (h *waitingHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	wi := old[n-1]
+	*h = old[:n-1]
+	return wi
+}
+
+// DelayQueue 在 WorkQueue 之上叠加了一个按到期时间排序的次级堆，
+// 用一个单独的 goroutine 等待最近的到期时间，到期后把条目转发给
+// Add，从而实现 AddAfter。
+type DelayQueue struct {
+	*WorkQueue
+
+	waitingMu sync.Mutex
+	waiting   waitingHeap
+	wakeupCh  chan struct{}
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// NewDelayQueue 创建一个支持 AddAfter 的 DelayQueue。
+func NewDelayQueue() *DelayQueue {
+	dq := &DelayQueue{
+		WorkQueue: NewWorkQueue(),
+		wakeupCh:  make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+	}
+	go dq.waitingLoop()
+	return dq
+}
+
+// AddAfter 让 item 在 d 之后才变为可处理状态。d <= 0 时等价于
+// 直接 Add。
+func (dq *DelayQueue) AddAfter(item interface{}, d time.Duration) {
+	if d <= 0 {
+		dq.Add(item)
+		return
+	}
+
+	dq.waitingMu.Lock()
+	heap.Push(&dq.waiting, &waitingItem{item: item, readyAt: time.Now().Add(d)})
+	dq.waitingMu.Unlock()
+
+	select {
+	case dq.wakeupCh <- struct{}{}:
+	default:
+	}
+}
+
+func (dq *DelayQueue) waitingLoop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		dq.waitingMu.Lock()
+		if len(dq.waiting) == 0 {
+			dq.waitingMu.Unlock()
+			select {
+			case <-dq.wakeupCh:
+				continue
+			case <-dq.stopCh:
+				return
+			}
+		}
+		next := dq.waiting[0]
+		dq.waitingMu.Unlock()
+
+		timer.Reset(time.Until(next.readyAt))
+
+		select {
+		case <-timer.C:
+			dq.waitingMu.Lock()
+			now := time.Now()
+			for len(dq.waiting) > 0 && !dq.waiting[0].readyAt.After(now) {
+				ready := heap.Pop(&dq.waiting).(*waitingItem)
+				dq.WorkQueue.Add(ready.item)
+			}
+			dq.waitingMu.Unlock()
+		case <-dq.wakeupCh:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-dq.stopCh:
+			return
+		}
+	}
+}
+
+// ShutDown 同时关闭底层 WorkQueue 和等待协程。
+func (dq *DelayQueue) ShutDown() {
+	dq.stopOnce.Do(func() { close(dq.stopCh) })
+	dq.WorkQueue.ShutDown()
+}
+
+// RateLimiter 决定一个条目在失败 failures 次之后应该再等待多久
+// 才能被重新处理。
+type RateLimiter interface {
+	When(item interface{}) time.Duration
+	Forget(item interface{})
+	NumRequeues(item interface{}) int
+}
+
+// ExponentialBackoffRateLimiter 按 base * 2^failures 计算退避时间，
+// 并在 max 处封顶。
+type ExponentialBackoffRateLimiter struct {
+	base time.Duration
+	max  time.Duration
+
+	mu       sync.Mutex
+	failures map[interface{}]int
+}
+
+// NewExponentialBackoffRateLimiter 创建一个指数退避限速器。
+func NewExponentialBackoffRateLimiter(base, max time.Duration) *ExponentialBackoffRateLimiter {
+	return &ExponentialBackoffRateLimiter{
+		base:     base,
+		max:      max,
+		failures: make(map[interface{}]int),
+	}
+}
+
+func (r *ExponentialBackoffRateLimiter) When(item interface{}) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures[item]++
+	backoff := float64(r.base) * math.Pow(2, float64(r.failures[item]-1))
+	if backoff > float64(math.MaxInt64) {
+		return r.max
+	}
+	if d := time.Duration(backoff); d < r.max {
+		return d
+	}
+	return r.max
+}
+
+func (r *ExponentialBackoffRateLimiter) NumRequeues(item interface{}) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failures[item]
+}
+
+func (r *ExponentialBackoffRateLimiter) Forget(item interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.failures, item)
+}
+
+// BucketRateLimiter 用 golang.org/x/time/rate 的令牌桶限制整体的
+// 重试速率，与单个条目的失败次数无关。
+type BucketRateLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewBucketRateLimiter 创建一个基于令牌桶的限速器。
+func NewBucketRateLimiter(limiter *rate.Limiter) *BucketRateLimiter {
+	return &BucketRateLimiter{limiter: limiter}
+}
+
+func (r *BucketRateLimiter) When(interface{}) time.Duration {
+	return r.limiter.Reserve().Delay()
+}
+
+func (r *BucketRateLimiter) NumRequeues(interface{}) int { return 0 }
+
+func (r *BucketRateLimiter) Forget(interface{}) {}
+
+// MaxOfRateLimiter 组合多个 RateLimiter，取它们中建议的最长延迟，
+// 用于同时套用"单条目退避"与"整体限速"两种策略。
+type MaxOfRateLimiter struct {
+	limiters []RateLimiter
+}
+
+// MaxOf 组合多个限速器。
+func MaxOf(limiters ...RateLimiter) *MaxOfRateLimiter {
+	return &MaxOfRateLimiter{limiters: limiters}
+}
+
+func (r *MaxOfRateLimiter) When(item interface{}) time.Duration {
+	var longest time.Duration
+	for _, l := range r.limiters {
+		if d := l.When(item); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+func (r *MaxOfRateLimiter) NumRequeues(item interface{}) int {
+	var max int
+	for _, l := range r.limiters {
+		if n := l.NumRequeues(item); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+func (r *MaxOfRateLimiter) Forget(item interface{}) {
+	for _, l := range r.limiters {
+		l.Forget(item)
+	}
+}
+
+// DefaultRateLimiter 是适用于 BankCounter 重试场景的默认限速器：
+// 单条目 5ms~1000s 的指数退避，叠加每秒 10、突发 100 的整体限速。
+func DefaultRateLimiter() RateLimiter {
+	return MaxOf(
+		NewExponentialBackoffRateLimiter(5*time.Millisecond, 1000*time.Second),
+		NewBucketRateLimiter(rate.NewLimiter(rate.Limit(10), 100)),
+	)
+}
+
+// RateLimitingQueue 在 DelayQueue 之上叠加限速重试：AddRateLimited
+// 根据 RateLimiter 的建议延迟调用 AddAfter，Forget 清除条目的失败
+// 计数，NumRequeues 暴露当前的重试次数供观测使用。
+type RateLimitingQueue struct {
+	*DelayQueue
+	limiter RateLimiter
+}
+
+// NewRateLimitingQueue 创建一个使用给定限速策略的 RateLimitingQueue。
+func NewRateLimitingQueue(limiter RateLimiter) *RateLimitingQueue {
+	return &RateLimitingQueue{
+		DelayQueue: NewDelayQueue(),
+		limiter:    limiter,
+	}
+}
+
+// AddRateLimited 按限速器建议的延迟重新排队 item。
+func (q *RateLimitingQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.limiter.When(item))
+}
+
+// Forget 清除 item 的失败计数，通常在处理成功之后调用。
+func (q *RateLimitingQueue) Forget(item interface{}) {
+	q.limiter.Forget(item)
+}
+
+// NumRequeues 返回 item 已经被 AddRateLimited 重新排队的次数。
+func (q *RateLimitingQueue) NumRequeues(item interface{}) int {
+	return q.limiter.NumRequeues(item)
+}
@@ -0,0 +1,79 @@
+package quest_system
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWorkQueueDedupesWhileProcessing 验证同一个条目在被处理期间再次
+// Add，只会在 Done 之后被重新排队一次，而不是排队两次。
+func TestWorkQueueDedupesWhileProcessing(t *testing.T) {
+	q := NewWorkQueue()
+
+	q.Add("ticket-1")
+	item, shutdown := q.Get()
+	if shutdown || item != "ticket-1" {
+		t.Fatalf("unexpected Get result: %v, %v", item, shutdown)
+	}
+
+	// 在处理期间重复 Add，不应该增加队列长度。
+	q.Add("ticket-1")
+	q.Add("ticket-1")
+	if got := q.Len(); got != 0 {
+		t.Errorf("expected no items queued while processing, got %d", got)
+	}
+
+	q.Done("ticket-1")
+	if got := q.Len(); got != 1 {
+		t.Errorf("expected item to be requeued after Done, got %d items", got)
+	}
+}
+
+// TestDelayQueueAddAfter 验证 AddAfter 延迟到期之前条目不可取，
+// 到期之后可以被 Get 到。
+func TestDelayQueueAddAfter(t *testing.T) {
+	q := NewDelayQueue()
+	defer q.ShutDown()
+
+	q.AddAfter("late-ticket", 20*time.Millisecond)
+
+	if got := q.Len(); got != 0 {
+		t.Errorf("expected item not ready yet, queue len = %d", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	item, shutdown := q.Get()
+	if shutdown || item != "late-ticket" {
+		t.Fatalf("expected late-ticket to be ready, got %v, shutdown=%v", item, shutdown)
+	}
+}
+
+// TestExponentialBackoffRateLimiterCapsAtMax 验证指数退避在达到 max
+// 之后不再继续增长。
+func TestExponentialBackoffRateLimiterCapsAtMax(t *testing.T) {
+	limiter := NewExponentialBackoffRateLimiter(10*time.Millisecond, 40*time.Millisecond)
+
+	delays := []time.Duration{
+		limiter.When("ticket-1"),
+		limiter.When("ticket-1"),
+		limiter.When("ticket-1"),
+		limiter.When("ticket-1"),
+	}
+
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond}
+	for i, d := range delays {
+		if d != want[i] {
+			t.Errorf("delay %d = %v, want %v", i, d, want[i])
+		}
+	}
+
+	if n := limiter.NumRequeues("ticket-1"); n != 4 {
+		t.Errorf("NumRequeues = %d, want 4", n)
+	}
+
+	limiter.Forget("ticket-1")
+	if n := limiter.NumRequeues("ticket-1"); n != 0 {
+		t.Errorf("NumRequeues after Forget = %d, want 0", n)
+	}
+}